@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // this will encode into n ignored/null bytes determined by the tag `binary:"i,n"`
@@ -28,7 +31,10 @@ const (
 )
 
 var (
-	ErrStringOverflow = errors.New("binary: string too large")
+	ErrStringOverflow  = errors.New("binary: string too large")
+	ErrUnsupportedType = errors.New("binary: unsupported type")
+	ErrBadTag          = errors.New("binary: malformed tag")
+	ErrTruncated       = errors.New("binary: truncated input")
 )
 
 type EncoderArgs struct {
@@ -36,363 +42,1217 @@ type EncoderArgs struct {
 	MaxStringLength  int
 }
 
-type binaryField struct {
-	v         reflect.Value
-	index     uint64
-	params    []string
-	endianess bool
+// checkMaxStringLength reports ErrStringOverflow if n (a string/byte-slice
+// length, either about to be encoded or just read off the wire) exceeds
+// args.MaxStringLength. A zero MaxStringLength means no limit.
+func checkMaxStringLength(n int, args EncoderArgs) error {
+	if args.MaxStringLength > 0 && n > args.MaxStringLength {
+		return ErrStringOverflow
+	}
+	return nil
+}
+
+// checkMaxUint64Length is checkMaxStringLength for a length that came off
+// the wire as a uint64 (LengthString64's prefix). The comparison must
+// happen in uint64 before any narrowing to int: for a 64 bit length
+// greater than math.MaxInt64, int(n) wraps negative, which would make
+// n > args.MaxStringLength false and let the bogus length straight
+// through to make([]byte, n).
+func checkMaxUint64Length(n uint64, args EncoderArgs) error {
+	if args.MaxStringLength > 0 && n > uint64(args.MaxStringLength) {
+		return ErrStringOverflow
+	}
+	return nil
+}
+
+// readFull reads exactly len(b) bytes, wrapping any error (including a
+// short read) in ErrTruncated so callers can distinguish "the input ended
+// early" from other failures with errors.Is.
+func readFull(in io.Reader, b []byte) (int, error) {
+	n, err := io.ReadFull(in, b)
+	if err != nil {
+		return n, fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	return n, nil
+}
+
+// zigZagEncode maps a signed integer onto an unsigned one so that small
+// magnitudes (positive or negative) stay numerically small, which is what
+// lets a signed `varint` field reuse the same unsigned scheme as `uvarint`.
+func zigZagEncode(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// zigZagDecode reverses zigZagEncode.
+func zigZagDecode(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+// appendVarint appends u's CBOR-style variable-length encoding to b: values
+// under 24 are a single byte equal to the value, anything larger is a
+// marker byte (24 plus the log2 of the tail width) followed by that many
+// big-endian bytes.
+func appendVarint(b []byte, u uint64) []byte {
+	switch {
+	case u < 24:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 24, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 25), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 26), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 27), u)
+	}
+}
+
+// sizeVarint reports how many bytes appendVarint would produce for u.
+func sizeVarint(u uint64) int {
+	switch {
+	case u < 24:
+		return 1
+	case u <= math.MaxUint8:
+		return 2
+	case u <= math.MaxUint16:
+		return 3
+	case u <= math.MaxUint32:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// readVarint reads one appendVarint-encoded value off in.
+func readVarint(in io.Reader) (uint64, int, error) {
+	b := make([]byte, 1)
+	n, err := readFull(in, b)
+	if err != nil {
+		return 0, n, err
+	}
+
+	var width int
+	switch marker := b[0]; {
+	case marker < 24:
+		return uint64(marker), n, nil
+	case marker == 24:
+		width = 1
+	case marker == 25:
+		width = 2
+	case marker == 26:
+		width = 4
+	case marker == 27:
+		width = 8
+	default:
+		return 0, n, fmt.Errorf("%w: bad varint marker byte %d", ErrBadTag, marker)
+	}
+
+	tail := make([]byte, width)
+	n2, err := readFull(in, tail)
+	if err != nil {
+		return 0, n + n2, err
+	}
+
+	switch width {
+	case 1:
+		return uint64(tail[0]), n + n2, nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(tail)), n + n2, nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(tail)), n + n2, nil
+	default:
+		return binary.BigEndian.Uint64(tail), n + n2, nil
+	}
 }
 
-func sortFields(t reflect.Value, args EncoderArgs) []binaryField {
+// taggedField is an intermediate result of parsing a single struct field's
+// `binary` tag, before the field's encode/decode behavior is compiled.
+type taggedField struct {
+	structIndex  int
+	tagIndex     uint64
+	params       []string
+	endianess    bool
+	endianessSet bool
+}
+
+// parseTaggedFields walks t's fields, parses each one's `binary` tag, and
+// returns them sorted into wire order.
+func parseTaggedFields(t reflect.Type) ([]taggedField, error) {
 	fc := t.NumField()
-	fields := make([]binaryField, 0, fc)
+	fields := make([]taggedField, 0, fc)
 	for i := 0; i < fc; i++ {
-		field := t.Type().Field(i)
-
-		tag, ok := field.Tag.Lookup("binary")
+		tag, ok := t.Field(i).Tag.Lookup("binary")
 		if !ok {
 			continue
 		}
 
-		f := binaryField{
-			v:         t.Field(i),
-			endianess: args.DefaultEndianess,
-		}
-
-		f.params = strings.Split(tag, ",")
+		f := taggedField{structIndex: i, params: strings.Split(tag, ",")}
 
 		var err error
-		f.index, err = strconv.ParseUint(f.params[0], 10, 64)
+		f.tagIndex, err = strconv.ParseUint(f.params[0], 10, 64)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("%w: field %s: tag index %q: %w", ErrBadTag, t.Field(i).Name, f.params[0], err)
 		}
 
 		for _, p := range f.params {
 			switch p {
 			case "big":
-				f.endianess = BigEndian
+				f.endianess, f.endianessSet = BigEndian, true
 			case "little":
-				f.endianess = LittleEndian
+				f.endianess, f.endianessSet = LittleEndian, true
 			}
 		}
 
 		fields = append(fields, f)
 	}
 
-	slices.SortFunc(fields, func(me binaryField, you binaryField) int {
-		return int(me.index) - int(you.index)
+	slices.SortFunc(fields, func(me taggedField, you taggedField) int {
+		return int(me.tagIndex) - int(you.tagIndex)
 	})
 
-	return fields
+	return fields, nil
 }
 
-func Marshal(in interface{}, args EncoderArgs) []byte {
-	t := reflect.ValueOf(in)
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+type encodeFunc func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error)
+type decodeFunc func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error)
+type sizeFunc func(c *Codec, v reflect.Value, args EncoderArgs) (int, error)
+
+// compiledField is a taggedField with its encode/decode/size behavior
+// already resolved, so that Marshal/Unmarshal/Size no longer need to
+// re-parse its tag on every call. Fields that resolve to marshalValue,
+// unmarshalValue and sizeValue still switch on the value's kind per call.
+type compiledField struct {
+	structIndex  int
+	name         string
+	tagIndex     uint64
+	endianess    bool
+	endianessSet bool
+	encode       encodeFunc
+	decode       decodeFunc
+	size         sizeFunc
+}
+
+// structPlan is the compiled, cacheable description of how to encode,
+// decode, and size every tagged field of a struct type, in wire order.
+type structPlan struct {
+	fields []compiledField
+}
+
+func buildStructPlan(c *Codec, t reflect.Type) (*structPlan, error) {
+	tagged, err := parseTaggedFields(t)
+	if err != nil {
+		return nil, err
 	}
-	fields := sortFields(t, args)
-
-	var b []byte
-	for _, field := range fields {
-		switch field.v.Type() {
-		case reflect.TypeFor[byte](): // 8 bit
-			b = append(b, field.v.Interface().(byte))
-		case reflect.TypeFor[uint8]():
-			b = append(b, field.v.Interface().(uint8))
-		case reflect.TypeFor[int8]():
-			b = append(b, byte(field.v.Interface().(int8)))
-		case reflect.TypeFor[uint16](): // 16 bit
-			v := field.v.Interface().(uint16)
-			if field.endianess {
-				b = binary.BigEndian.AppendUint16(b, v)
-			} else {
-				b = binary.LittleEndian.AppendUint16(b, v)
-			}
-		case reflect.TypeFor[int16]():
-			v := uint16(field.v.Interface().(int16))
-			if field.endianess {
-				b = binary.BigEndian.AppendUint16(b, v)
-			} else {
-				b = binary.LittleEndian.AppendUint16(b, v)
-			}
-		case reflect.TypeFor[uint32](): // 32 bit
-			v := field.v.Interface().(uint32)
-			if field.endianess {
-				b = binary.BigEndian.AppendUint32(b, v)
-			} else {
-				b = binary.LittleEndian.AppendUint32(b, v)
-			}
-		case reflect.TypeFor[int32]():
-			v := uint32(field.v.Interface().(int32))
-			if field.endianess {
-				b = binary.BigEndian.AppendUint32(b, v)
-			} else {
-				b = binary.LittleEndian.AppendUint32(b, v)
-			}
-		case reflect.TypeFor[uint](), reflect.TypeFor[uintptr](), reflect.TypeFor[uint64](): // 64 bit (native ints should be treated as 64 bit)
-			v := field.v.Uint()
-			if field.endianess {
-				b = binary.BigEndian.AppendUint64(b, v)
-			} else {
-				b = binary.LittleEndian.AppendUint64(b, v)
-			}
-		case reflect.TypeFor[int](), reflect.TypeFor[int64]():
-			v := uint64(field.v.Int())
-			if field.endianess {
-				b = binary.BigEndian.AppendUint64(b, v)
-			} else {
-				b = binary.LittleEndian.AppendUint64(b, v)
-			}
-		case reflect.TypeFor[Padding](): // variable length
-			count, err := strconv.ParseInt(field.params[1], 10, 64)
-			if err != nil {
-				panic(err)
-			}
-			b = append(b, bytes.Repeat([]byte{'\000'}, int(count))...)
-		case reflect.TypeFor[NullString]():
-			b = append(b, append(field.v.Interface().(NullString), '\000')...)
-		case reflect.TypeFor[LengthString]():
-			ls := field.v.Interface().(LengthString)
-			b = append(b, append([]byte{byte(len(ls))}, ls...)...)
-		case reflect.TypeFor[LengthString16]():
-			ls := field.v.Interface().(LengthString16)
-			if field.endianess {
-				b = append(b, append(binary.BigEndian.AppendUint16(nil, uint16(len(ls))), ls...)...)
-			} else {
-				b = append(b, append(binary.LittleEndian.AppendUint16(nil, uint16(len(ls))), ls...)...)
-			}
-		case reflect.TypeFor[LengthString32]():
-			ls := field.v.Interface().(LengthString32)
-			if field.endianess {
-				b = append(b, append(binary.BigEndian.AppendUint32(nil, uint32(len(ls))), ls...)...)
-			} else {
-				b = append(b, append(binary.LittleEndian.AppendUint32(nil, uint32(len(ls))), ls...)...)
-			}
-		case reflect.TypeFor[LengthString64]():
-			ls := field.v.Interface().(LengthString64)
-			if field.endianess {
-				b = append(b, append(binary.BigEndian.AppendUint64(nil, uint64(len(ls))), ls...)...)
-			} else {
-				b = append(b, append(binary.LittleEndian.AppendUint64(nil, uint64(len(ls))), ls...)...)
-			}
-		case reflect.TypeFor[string]():
-			b = append(b, []byte(field.v.Interface().(string))...)
-		case reflect.TypeFor[[]byte]():
-			b = append(b, field.v.Interface().([]byte)...)
-		default:
-			panic("cannot binary encode: unsupported type")
+
+	plan := &structPlan{fields: make([]compiledField, len(tagged))}
+	for i, f := range tagged {
+		sf := t.Field(f.structIndex)
+		enc, dec, sz, err := compileFieldCodec(c, sf.Type, f.params)
+		if err != nil {
+			return nil, fmt.Errorf("binary: field %s (tag %d): %w", sf.Name, f.tagIndex, err)
+		}
+		plan.fields[i] = compiledField{
+			structIndex:  f.structIndex,
+			name:         sf.Name,
+			tagIndex:     f.tagIndex,
+			endianess:    f.endianess,
+			endianessSet: f.endianessSet,
+			encode:       enc,
+			decode:       dec,
+			size:         sz,
 		}
 	}
-	return b
+	return plan, nil
 }
 
-func Unmarshal(in io.Reader, out interface{}, args EncoderArgs) error {
-	t := reflect.ValueOf(out)
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+// varintTag reports whether params request CBOR-style variable-length
+// integer encoding via a `varint` or `uvarint` param, and if so whether the
+// signed (zig-zag) or unsigned variant was asked for.
+func varintTag(params []string) (signed bool, ok bool) {
+	for _, p := range params {
+		switch p {
+		case "varint":
+			return true, true
+		case "uvarint":
+			return false, true
+		}
 	}
-	fields := sortFields(t, args)
+	return false, false
+}
 
-	var rc int
-	for _, field := range fields {
-		if !field.v.CanSet() {
-			continue
+func isSignedIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isUnsignedIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+// varintCodec builds the encode/decode/size closures for a `varint` or
+// `uvarint` tagged integer field of any width, so it needs no separate
+// length-prefix field the way a slice does.
+func varintCodec(ft reflect.Type, signed bool) (encodeFunc, decodeFunc, sizeFunc, error) {
+	switch {
+	case signed && !isSignedIntKind(ft.Kind()):
+		return nil, nil, nil, fmt.Errorf("%w: varint requires a signed integer field, got %s", ErrBadTag, ft.Kind())
+	case !signed && !isUnsignedIntKind(ft.Kind()):
+		return nil, nil, nil, fmt.Errorf("%w: uvarint requires an unsigned integer field, got %s", ErrBadTag, ft.Kind())
+	}
+
+	toUint := func(v reflect.Value) uint64 {
+		if signed {
+			return zigZagEncode(v.Int())
 		}
-		switch field.v.Type() {
-		case reflect.TypeFor[byte](), reflect.TypeFor[uint8](): // 8 bit
-			b := make([]byte, 1)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			field.v.SetUint(uint64(b[0]))
-		case reflect.TypeFor[int8]():
-			b := make([]byte, 1)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			field.v.SetInt(int64(b[0]))
-		case reflect.TypeFor[uint16](): // 16 bit
-			b := make([]byte, 2)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			if field.endianess {
-				field.v.SetUint(uint64(binary.BigEndian.Uint16(b)))
-			} else {
-				field.v.SetUint(uint64(binary.LittleEndian.Uint16(b)))
-			}
-		case reflect.TypeFor[int16]():
-			b := make([]byte, 2)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			if field.endianess {
-				field.v.SetInt(int64(binary.BigEndian.Uint16(b)))
-			} else {
-				field.v.SetInt(int64(binary.LittleEndian.Uint16(b)))
-			}
-		case reflect.TypeFor[uint32](): // 32 bit
-			b := make([]byte, 4)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			if field.endianess {
-				field.v.SetUint(uint64(binary.BigEndian.Uint32(b)))
-			} else {
-				field.v.SetUint(uint64(binary.LittleEndian.Uint32(b)))
-			}
-		case reflect.TypeFor[int32]():
-			b := make([]byte, 4)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			if field.endianess {
-				field.v.SetInt(int64(binary.BigEndian.Uint32(b)))
-			} else {
-				field.v.SetInt(int64(binary.LittleEndian.Uint32(b)))
-			}
-		case reflect.TypeFor[uint](), reflect.TypeFor[uintptr](), reflect.TypeFor[uint64](): // 64 bit (native ints should be treated as 64 bit)
-			b := make([]byte, 8)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			if field.endianess {
-				field.v.SetUint(binary.BigEndian.Uint64(b))
-			} else {
-				field.v.SetUint(binary.LittleEndian.Uint64(b))
-			}
-		case reflect.TypeFor[int](), reflect.TypeFor[int64]():
-			b := make([]byte, 8)
-			n, err := in.Read(b)
+		return v.Uint()
+	}
+
+	return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+			return appendVarint(nil, toUint(v)), nil
+		}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+			u, n, err := readVarint(in)
 			if err != nil {
-				return err
+				return n, err
 			}
-			rc += n
-			if field.endianess {
-				field.v.SetInt(int64(binary.BigEndian.Uint64(b)))
+			if signed {
+				v.SetInt(zigZagDecode(u))
 			} else {
-				field.v.SetInt(int64(binary.LittleEndian.Uint64(b)))
-			}
-		case reflect.TypeFor[Padding](): // variable length
-			count, err := strconv.ParseInt(field.params[1], 10, 64)
-			if err != nil {
-				panic(err)
+				v.SetUint(u)
 			}
-			n, err := in.Read(make([]byte, count))
-			rc += n
-			if err != nil {
-				return err
-			}
-		case reflect.TypeFor[NullString]():
-			var str NullString
-			b := make([]byte, 1)
-			for {
-				n, err := in.Read(b)
+			return n, nil
+		}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+			return sizeVarint(toUint(v)), nil
+		}, nil
+}
+
+// compileFieldCodec picks the encode/decode/size closures for a single
+// field, based on its type and (for Padding, varint/uvarint and slices) its
+// tag parameters. For Padding, the string types, varint/uvarint fields and
+// slices the type switch runs once, at plan build time; fields of the other
+// fixed-size kinds, arrays and nested structs get marshalValue,
+// unmarshalValue and sizeValue, which switch on the value's kind on every
+// call.
+func compileFieldCodec(c *Codec, ft reflect.Type, params []string) (encodeFunc, decodeFunc, sizeFunc, error) {
+	switch ft {
+	case reflect.TypeFor[Padding](): // variable length, fixed at plan build time
+		count, err := strconv.ParseInt(params[1], 10, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: padding count %q: %w", ErrBadTag, params[1], err)
+		}
+		return func(*Codec, reflect.Value, bool, EncoderArgs) ([]byte, error) {
+				return bytes.Repeat([]byte{'\000'}, int(count)), nil
+			}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+				return readFull(in, make([]byte, count))
+			}, func(*Codec, reflect.Value, EncoderArgs) (int, error) {
+				return int(count), nil
+			}, nil
+	case reflect.TypeFor[NullString]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				ns := v.Interface().(NullString)
+				if err := checkMaxStringLength(len(ns), args); err != nil {
+					return nil, err
+				}
+				return append(append([]byte{}, ns...), '\000'), nil
+			}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+				var str NullString
+				b := make([]byte, 1)
+				var rc int
+				for {
+					n, err := readFull(in, b)
+					rc += n
+					if err != nil {
+						return rc, err
+					}
+					if b[0] == '\000' {
+						break
+					}
+					if err := checkMaxStringLength(len(str)+1, args); err != nil {
+						return rc, err
+					}
+					str = append(str, b[0])
+				}
+				v.Set(reflect.ValueOf(str))
+				return rc, nil
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				n := len(v.Interface().(NullString))
+				if err := checkMaxStringLength(n, args); err != nil {
+					return 0, err
+				}
+				return n + 1, nil
+			}, nil
+	case reflect.TypeFor[LengthString]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				ls := v.Interface().(LengthString)
+				if err := checkMaxStringLength(len(ls), args); err != nil {
+					return nil, err
+				}
+				return append([]byte{byte(len(ls))}, ls...), nil
+			}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+				b := make([]byte, 1)
+				n, err := readFull(in, b)
 				if err != nil {
-					return err
+					return n, err
 				}
-				rc += n
-				if b[0] == '\000' {
-					break
+				length := uint8(b[0])
+				if err := checkMaxStringLength(int(length), args); err != nil {
+					return n, err
 				}
-				str = append(str, b[0])
-			}
-			field.v.Set(reflect.ValueOf(str))
-		case reflect.TypeFor[LengthString]():
-			b := make([]byte, 1)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			length := uint8(b[0])
-			b = make([]byte, length)
-			n, err = in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			field.v.SetBytes(b)
-		case reflect.TypeFor[LengthString16]():
-			b := make([]byte, 2)
-			n, err := in.Read(b)
-			if err != nil {
-				return err
-			}
-			rc += n
-			var length uint16
-			if field.endianess {
-				length = binary.BigEndian.Uint16(b)
-			} else {
-				length = binary.LittleEndian.Uint16(b)
-			}
-			b = make([]byte, length)
-			n, err = in.Read(b)
+				b = make([]byte, length)
+				n2, err := readFull(in, b)
+				if err != nil {
+					return n + n2, err
+				}
+				v.SetBytes(b)
+				return n + n2, nil
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				n := len(v.Interface().(LengthString))
+				if err := checkMaxStringLength(n, args); err != nil {
+					return 0, err
+				}
+				return 1 + n, nil
+			}, nil
+	case reflect.TypeFor[LengthString16]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				ls := v.Interface().(LengthString16)
+				if err := checkMaxStringLength(len(ls), args); err != nil {
+					return nil, err
+				}
+				if endianess {
+					return append(binary.BigEndian.AppendUint16(nil, uint16(len(ls))), ls...), nil
+				}
+				return append(binary.LittleEndian.AppendUint16(nil, uint16(len(ls))), ls...), nil
+			}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+				b := make([]byte, 2)
+				n, err := readFull(in, b)
+				if err != nil {
+					return n, err
+				}
+				var length uint16
+				if endianess {
+					length = binary.BigEndian.Uint16(b)
+				} else {
+					length = binary.LittleEndian.Uint16(b)
+				}
+				if err := checkMaxStringLength(int(length), args); err != nil {
+					return n, err
+				}
+				b = make([]byte, length)
+				n2, err := readFull(in, b)
+				if err != nil {
+					return n + n2, err
+				}
+				v.SetBytes(b)
+				return n + n2, nil
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				n := len(v.Interface().(LengthString16))
+				if err := checkMaxStringLength(n, args); err != nil {
+					return 0, err
+				}
+				return 2 + n, nil
+			}, nil
+	case reflect.TypeFor[LengthString32]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				ls := v.Interface().(LengthString32)
+				if err := checkMaxStringLength(len(ls), args); err != nil {
+					return nil, err
+				}
+				if endianess {
+					return append(binary.BigEndian.AppendUint32(nil, uint32(len(ls))), ls...), nil
+				}
+				return append(binary.LittleEndian.AppendUint32(nil, uint32(len(ls))), ls...), nil
+			}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+				b := make([]byte, 4)
+				n, err := readFull(in, b)
+				if err != nil {
+					return n, err
+				}
+				var length uint32
+				if endianess {
+					length = binary.BigEndian.Uint32(b)
+				} else {
+					length = binary.LittleEndian.Uint32(b)
+				}
+				if err := checkMaxStringLength(int(length), args); err != nil {
+					return n, err
+				}
+				b = make([]byte, length)
+				n2, err := readFull(in, b)
+				if err != nil {
+					return n + n2, err
+				}
+				v.SetBytes(b)
+				return n + n2, nil
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				n := len(v.Interface().(LengthString32))
+				if err := checkMaxStringLength(n, args); err != nil {
+					return 0, err
+				}
+				return 4 + n, nil
+			}, nil
+	case reflect.TypeFor[LengthString64]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				ls := v.Interface().(LengthString64)
+				if err := checkMaxStringLength(len(ls), args); err != nil {
+					return nil, err
+				}
+				if endianess {
+					return append(binary.BigEndian.AppendUint64(nil, uint64(len(ls))), ls...), nil
+				}
+				return append(binary.LittleEndian.AppendUint64(nil, uint64(len(ls))), ls...), nil
+			}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+				b := make([]byte, 8)
+				n, err := readFull(in, b)
+				if err != nil {
+					return n, err
+				}
+				var length uint64
+				if endianess {
+					length = binary.BigEndian.Uint64(b)
+				} else {
+					length = binary.LittleEndian.Uint64(b)
+				}
+				// length comes straight off the wire as a uint64, so the
+				// overflow check must run on it before any narrowing to
+				// int (and before make([]byte, length) allocates).
+				if err := checkMaxUint64Length(length, args); err != nil {
+					return n, err
+				}
+				b = make([]byte, length)
+				n2, err := readFull(in, b)
+				if err != nil {
+					return n + n2, err
+				}
+				v.SetBytes(b)
+				return n + n2, nil
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				n := len(v.Interface().(LengthString64))
+				if err := checkMaxStringLength(n, args); err != nil {
+					return 0, err
+				}
+				return 8 + n, nil
+			}, nil
+	case reflect.TypeFor[string]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				return []byte(v.Interface().(string)), nil
+			}, func(*Codec, io.Reader, reflect.Value, bool, EncoderArgs) (int, error) {
+				return 0, fmt.Errorf("%w: string and []byte fields cannot be unmarshaled", ErrUnsupportedType)
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				return len(v.Interface().(string)), nil
+			}, nil
+	case reflect.TypeFor[[]byte]():
+		return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+				b := v.Interface().([]byte)
+				if err := checkMaxStringLength(len(b), args); err != nil {
+					return nil, err
+				}
+				return b, nil
+			}, func(*Codec, io.Reader, reflect.Value, bool, EncoderArgs) (int, error) {
+				return 0, fmt.Errorf("%w: string and []byte fields cannot be unmarshaled", ErrUnsupportedType)
+			}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+				n := len(v.Interface().([]byte))
+				if err := checkMaxStringLength(n, args); err != nil {
+					return 0, err
+				}
+				return n, nil
+			}, nil
+	default:
+		if signed, ok := varintTag(params); ok {
+			return varintCodec(ft, signed)
+		}
+		if ft.Kind() == reflect.Slice {
+			lenTag, err := sliceLenTag(params)
 			if err != nil {
-				return err
+				return nil, nil, nil, err
 			}
-			rc += n
-			field.v.SetBytes(b)
-		case reflect.TypeFor[LengthString32]():
-			b := make([]byte, 4)
-			n, err := in.Read(b)
+			prefixWidth, err := sliceLenPrefixWidth(lenTag)
 			if err != nil {
-				return err
-			}
-			rc += n
-			var length uint32
-			if field.endianess {
-				length = binary.BigEndian.Uint32(b)
-			} else {
-				length = binary.LittleEndian.Uint32(b)
+				return nil, nil, nil, err
 			}
-			b = make([]byte, length)
-			n, err = in.Read(b)
+			return func(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+					n := v.Len()
+					b, err := appendSliceLen(nil, lenTag, n, endianess)
+					if err != nil {
+						return nil, err
+					}
+					for i := 0; i < n; i++ {
+						eb, err := marshalValue(c, v.Index(i), endianess, args)
+						if err != nil {
+							return nil, err
+						}
+						b = append(b, eb...)
+					}
+					return b, nil
+				}, func(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+					l, rc, err := readSliceLen(in, lenTag, endianess, args)
+					if err != nil {
+						return rc, err
+					}
+					slice := reflect.MakeSlice(v.Type(), l, l)
+					for i := 0; i < l; i++ {
+						n, err := unmarshalValue(c, in, slice.Index(i), endianess, args)
+						rc += n
+						if err != nil {
+							return rc, err
+						}
+					}
+					v.Set(slice)
+					return rc, nil
+				}, func(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+					size := prefixWidth
+					for i := 0; i < v.Len(); i++ {
+						es, err := sizeValue(c, v.Index(i), args)
+						if err != nil {
+							return 0, err
+						}
+						size += es
+					}
+					return size, nil
+				}, nil
+		}
+		return marshalValue, unmarshalValue, sizeValue, nil
+	}
+}
+
+// Codec caches the compiled field plan for every struct type it has seen,
+// so repeated Marshal/Unmarshal/Size calls for the same type skip tag
+// parsing. The zero value is ready to use.
+type Codec struct {
+	plans sync.Map // map[reflect.Type]*structPlan
+}
+
+// NewCodec returns a ready-to-use Codec.
+func NewCodec() *Codec {
+	return &Codec{}
+}
+
+// RegisterType pre-computes and caches the field plan for v's type (or the
+// type it points to), so the first Marshal/Unmarshal of that type doesn't
+// pay the one-time compilation cost.
+func (c *Codec) RegisterType(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return errors.New("binary: RegisterType requires a struct or a pointer to one, got nil")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return errors.New("binary: RegisterType requires a struct or a pointer to one")
+	}
+	plan, err := buildStructPlan(c, t)
+	if err != nil {
+		return err
+	}
+	c.plans.Store(t, plan)
+	return nil
+}
+
+func (c *Codec) planFor(t reflect.Type) (*structPlan, error) {
+	if p, ok := c.plans.Load(t); ok {
+		return p.(*structPlan), nil
+	}
+	plan, err := buildStructPlan(c, t)
+	if err != nil {
+		return nil, err
+	}
+	c.plans.Store(t, plan)
+	return plan, nil
+}
+
+// Marshal encodes in using this Codec's cached field plan for its type.
+func (c *Codec) Marshal(in interface{}, args EncoderArgs) ([]byte, error) {
+	t := reflect.ValueOf(in)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return c.marshalPlan(nil, t, args)
+}
+
+// Append encodes in using this Codec's cached field plan for its type,
+// appending to and returning buf so callers can reuse a buffer across
+// calls instead of letting Marshal allocate a fresh one each time.
+func (c *Codec) Append(buf []byte, in interface{}, args EncoderArgs) ([]byte, error) {
+	t := reflect.ValueOf(in)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return c.marshalPlan(buf, t, args)
+}
+
+func (c *Codec) marshalPlan(buf []byte, t reflect.Value, args EncoderArgs) ([]byte, error) {
+	plan, err := c.planFor(t.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	b := buf
+	for _, field := range plan.fields {
+		endianess := field.endianess
+		if !field.endianessSet {
+			endianess = args.DefaultEndianess
+		}
+		fb, err := field.encode(c, t.Field(field.structIndex), endianess, args)
+		if err != nil {
+			return nil, fmt.Errorf("binary: field %s (tag %d): %w", field.name, field.tagIndex, err)
+		}
+		b = append(b, fb...)
+	}
+	return b, nil
+}
+
+// Size returns the exact number of bytes Marshal would produce for in,
+// without encoding it, using this Codec's cached field plan for its type.
+func (c *Codec) Size(in interface{}, args EncoderArgs) (int, error) {
+	t := reflect.ValueOf(in)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return c.sizePlan(t, args)
+}
+
+func (c *Codec) sizePlan(t reflect.Value, args EncoderArgs) (int, error) {
+	plan, err := c.planFor(t.Type())
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for _, field := range plan.fields {
+		n, err := field.size(c, t.Field(field.structIndex), args)
+		if err != nil {
+			return 0, fmt.Errorf("binary: field %s (tag %d): %w", field.name, field.tagIndex, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Unmarshal decodes into out using this Codec's cached field plan for its
+// type.
+func (c *Codec) Unmarshal(in io.Reader, out interface{}, args EncoderArgs) error {
+	t := reflect.ValueOf(out)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	_, err := c.unmarshalPlan(in, t, args)
+	return err
+}
+
+func (c *Codec) unmarshalPlan(in io.Reader, t reflect.Value, args EncoderArgs) (int, error) {
+	plan, err := c.planFor(t.Type())
+	if err != nil {
+		return 0, err
+	}
+
+	var rc int
+	for _, field := range plan.fields {
+		fv := t.Field(field.structIndex)
+		if !fv.CanSet() {
+			continue
+		}
+		endianess := field.endianess
+		if !field.endianessSet {
+			endianess = args.DefaultEndianess
+		}
+		n, err := field.decode(c, in, fv, endianess, args)
+		rc += n
+		if err != nil {
+			return rc, fmt.Errorf("binary: field %s (tag %d): %w", field.name, field.tagIndex, err)
+		}
+	}
+	return rc, nil
+}
+
+// defaultCodec backs the package-level Marshal/Append/Encode/Size and
+// Unmarshal/Decode, so ad-hoc callers still benefit from plan caching
+// without having to manage their own Codec. Nested structs are planned and
+// cached in whichever Codec encodes or decodes their parent.
+var defaultCodec = NewCodec()
+
+// marshalValue encodes a single value of one of the supported fixed-size
+// kinds (or an array/nested struct of such values) with no length prefix.
+// It is used both for struct fields directly and for the elements of
+// arrays and slices.
+func marshalValue(c *Codec, v reflect.Value, endianess bool, args EncoderArgs) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Uint8: // 8 bit
+		return []byte{byte(v.Uint())}, nil
+	case reflect.Int8:
+		return []byte{byte(v.Int())}, nil
+	case reflect.Uint16: // 16 bit
+		if endianess {
+			return binary.BigEndian.AppendUint16(nil, uint16(v.Uint())), nil
+		}
+		return binary.LittleEndian.AppendUint16(nil, uint16(v.Uint())), nil
+	case reflect.Int16:
+		if endianess {
+			return binary.BigEndian.AppendUint16(nil, uint16(v.Int())), nil
+		}
+		return binary.LittleEndian.AppendUint16(nil, uint16(v.Int())), nil
+	case reflect.Uint32: // 32 bit
+		if endianess {
+			return binary.BigEndian.AppendUint32(nil, uint32(v.Uint())), nil
+		}
+		return binary.LittleEndian.AppendUint32(nil, uint32(v.Uint())), nil
+	case reflect.Int32:
+		if endianess {
+			return binary.BigEndian.AppendUint32(nil, uint32(v.Int())), nil
+		}
+		return binary.LittleEndian.AppendUint32(nil, uint32(v.Int())), nil
+	case reflect.Uint, reflect.Uintptr, reflect.Uint64: // 64 bit (native ints should be treated as 64 bit)
+		if endianess {
+			return binary.BigEndian.AppendUint64(nil, v.Uint()), nil
+		}
+		return binary.LittleEndian.AppendUint64(nil, v.Uint()), nil
+	case reflect.Int, reflect.Int64:
+		if endianess {
+			return binary.BigEndian.AppendUint64(nil, uint64(v.Int())), nil
+		}
+		return binary.LittleEndian.AppendUint64(nil, uint64(v.Int())), nil
+	case reflect.Bool: // 1 byte
+		if v.Bool() {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case reflect.Float32: // IEEE-754 32 bit
+		bits := math.Float32bits(float32(v.Float()))
+		if endianess {
+			return binary.BigEndian.AppendUint32(nil, bits), nil
+		}
+		return binary.LittleEndian.AppendUint32(nil, bits), nil
+	case reflect.Float64: // IEEE-754 64 bit
+		bits := math.Float64bits(v.Float())
+		if endianess {
+			return binary.BigEndian.AppendUint64(nil, bits), nil
+		}
+		return binary.LittleEndian.AppendUint64(nil, bits), nil
+	case reflect.Complex64: // two IEEE-754 32 bit halves, real then imaginary
+		c := v.Complex()
+		re := math.Float32bits(float32(real(c)))
+		im := math.Float32bits(float32(imag(c)))
+		if endianess {
+			return append(binary.BigEndian.AppendUint32(nil, re), binary.BigEndian.AppendUint32(nil, im)...), nil
+		}
+		return append(binary.LittleEndian.AppendUint32(nil, re), binary.LittleEndian.AppendUint32(nil, im)...), nil
+	case reflect.Complex128: // two IEEE-754 64 bit halves, real then imaginary
+		c := v.Complex()
+		re := math.Float64bits(real(c))
+		im := math.Float64bits(imag(c))
+		if endianess {
+			return append(binary.BigEndian.AppendUint64(nil, re), binary.BigEndian.AppendUint64(nil, im)...), nil
+		}
+		return append(binary.LittleEndian.AppendUint64(nil, re), binary.LittleEndian.AppendUint64(nil, im)...), nil
+	case reflect.Array: // fixed length, size known from the type, no length prefix
+		var b []byte
+		for i := 0; i < v.Len(); i++ {
+			eb, err := marshalValue(c, v.Index(i), endianess, args)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			rc += n
-			field.v.SetBytes(b)
-		case reflect.TypeFor[LengthString64]():
-			b := make([]byte, 8)
-			n, err := in.Read(b)
+			b = append(b, eb...)
+		}
+		return b, nil
+	case reflect.Struct: // nested struct, recurses to arbitrary depth
+		return c.marshalPlan(nil, v, EncoderArgs{DefaultEndianess: endianess, MaxStringLength: args.MaxStringLength})
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, v.Kind())
+	}
+}
+
+// sizeValue is the read-without-decoding counterpart of marshalValue: it
+// reports how many bytes marshalValue would produce for v, without doing
+// any encoding.
+func sizeValue(c *Codec, v reflect.Value, args EncoderArgs) (int, error) {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Int8, reflect.Bool: // 1 byte
+		return 1, nil
+	case reflect.Uint16, reflect.Int16: // 2 byte
+		return 2, nil
+	case reflect.Uint32, reflect.Int32, reflect.Float32: // 4 byte
+		return 4, nil
+	case reflect.Uint, reflect.Uintptr, reflect.Uint64, reflect.Int, reflect.Int64, reflect.Float64, reflect.Complex64: // 8 byte
+		return 8, nil
+	case reflect.Complex128: // two IEEE-754 64 bit halves
+		return 16, nil
+	case reflect.Array: // fixed length, size known from the type, no length prefix
+		var total int
+		for i := 0; i < v.Len(); i++ {
+			n, err := sizeValue(c, v.Index(i), args)
 			if err != nil {
-				return err
+				return 0, err
 			}
+			total += n
+		}
+		return total, nil
+	case reflect.Struct: // nested struct, recurses to arbitrary depth
+		return c.sizePlan(v, args)
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedType, v.Kind())
+	}
+}
+
+// sliceLenTag finds the `len=` spec in a slice field's tag params, e.g.
+// "u16" out of `binary:"5,len=u16,big"`.
+func sliceLenTag(params []string) (string, error) {
+	for _, p := range params {
+		if rest, ok := strings.CutPrefix(p, "len="); ok {
+			return rest, nil
+		}
+	}
+	return "", fmt.Errorf("%w: slice field is missing a len= tag", ErrBadTag)
+}
+
+// sliceLenPrefixWidth returns the number of bytes a slice's len= tag
+// reserves for its length prefix.
+func sliceLenPrefixWidth(lenTag string) (int, error) {
+	switch lenTag {
+	case "u8":
+		return 1, nil
+	case "u16":
+		return 2, nil
+	case "u32":
+		return 4, nil
+	case "u64":
+		return 8, nil
+	default:
+		return 0, fmt.Errorf("%w: unsupported len= width %q", ErrBadTag, lenTag)
+	}
+}
+
+// appendSliceLen appends the length-prefix for a slice field using the width
+// named by its len= tag.
+func appendSliceLen(b []byte, lenTag string, n int, endianess bool) ([]byte, error) {
+	switch lenTag {
+	case "u8":
+		return append(b, byte(n)), nil
+	case "u16":
+		if endianess {
+			return binary.BigEndian.AppendUint16(b, uint16(n)), nil
+		}
+		return binary.LittleEndian.AppendUint16(b, uint16(n)), nil
+	case "u32":
+		if endianess {
+			return binary.BigEndian.AppendUint32(b, uint32(n)), nil
+		}
+		return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+	case "u64":
+		if endianess {
+			return binary.BigEndian.AppendUint64(b, uint64(n)), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, uint64(n)), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported len= width %q", ErrBadTag, lenTag)
+	}
+}
+
+// Marshal encodes in's tagged fields in order, using the package-level
+// default Codec. Repeated calls for the same struct type reuse its cached
+// field plan.
+func Marshal(in interface{}, args EncoderArgs) ([]byte, error) {
+	return defaultCodec.Marshal(in, args)
+}
+
+// Append encodes in's tagged fields in order, appending to and returning
+// buf. It lets callers reuse a buffer across calls instead of letting
+// Marshal allocate a fresh slice every time.
+func Append(buf []byte, in interface{}, args EncoderArgs) ([]byte, error) {
+	return defaultCodec.Append(buf, in, args)
+}
+
+// Encode is like Append, but writes into buf in place and returns the
+// number of bytes written instead of growing buf. It returns
+// io.ErrShortBuffer if buf is too small to hold the encoded value; in
+// that case buf is left untouched.
+func Encode(buf []byte, in interface{}, args EncoderArgs) (int, error) {
+	size, err := Size(in, args)
+	if err != nil {
+		return 0, err
+	}
+	if size > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+	out, err := Append(buf[:0], in, args)
+	if err != nil {
+		return 0, err
+	}
+	return len(out), nil
+}
+
+// Size returns the exact number of bytes Marshal would produce for in,
+// without encoding it, using the package-level default Codec. Callers can
+// use this to pre-size a buffer for Encode or to reject an oversized
+// value before spending any work on it.
+func Size(in interface{}, args EncoderArgs) (int, error) {
+	return defaultCodec.Size(in, args)
+}
+
+// unmarshalValue is the read-side counterpart of marshalValue: it decodes a
+// single value of one of the supported fixed-size kinds (or an
+// array/nested struct of such values) into v, which must be settable.
+func unmarshalValue(c *Codec, in io.Reader, v reflect.Value, endianess bool, args EncoderArgs) (int, error) {
+	switch v.Kind() {
+	case reflect.Uint8: // 8 bit
+		b := make([]byte, 1)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		v.SetUint(uint64(b[0]))
+		return n, nil
+	case reflect.Int8:
+		b := make([]byte, 1)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		v.SetInt(int64(int8(b[0])))
+		return n, nil
+	case reflect.Uint16: // 16 bit
+		b := make([]byte, 2)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetUint(uint64(binary.BigEndian.Uint16(b)))
+		} else {
+			v.SetUint(uint64(binary.LittleEndian.Uint16(b)))
+		}
+		return n, nil
+	case reflect.Int16:
+		b := make([]byte, 2)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetInt(int64(int16(binary.BigEndian.Uint16(b))))
+		} else {
+			v.SetInt(int64(int16(binary.LittleEndian.Uint16(b))))
+		}
+		return n, nil
+	case reflect.Uint32: // 32 bit
+		b := make([]byte, 4)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetUint(uint64(binary.BigEndian.Uint32(b)))
+		} else {
+			v.SetUint(uint64(binary.LittleEndian.Uint32(b)))
+		}
+		return n, nil
+	case reflect.Int32:
+		b := make([]byte, 4)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetInt(int64(int32(binary.BigEndian.Uint32(b))))
+		} else {
+			v.SetInt(int64(int32(binary.LittleEndian.Uint32(b))))
+		}
+		return n, nil
+	case reflect.Uint, reflect.Uintptr, reflect.Uint64: // 64 bit (native ints should be treated as 64 bit)
+		b := make([]byte, 8)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetUint(binary.BigEndian.Uint64(b))
+		} else {
+			v.SetUint(binary.LittleEndian.Uint64(b))
+		}
+		return n, nil
+	case reflect.Int, reflect.Int64:
+		b := make([]byte, 8)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetInt(int64(binary.BigEndian.Uint64(b)))
+		} else {
+			v.SetInt(int64(binary.LittleEndian.Uint64(b)))
+		}
+		return n, nil
+	case reflect.Bool: // 1 byte
+		b := make([]byte, 1)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		v.SetBool(b[0] != 0)
+		return n, nil
+	case reflect.Float32: // IEEE-754 32 bit
+		b := make([]byte, 4)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(b))))
+		} else {
+			v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		}
+		return n, nil
+	case reflect.Float64: // IEEE-754 64 bit
+		b := make([]byte, 8)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		if endianess {
+			v.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		} else {
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+		return n, nil
+	case reflect.Complex64: // two IEEE-754 32 bit halves, real then imaginary
+		b := make([]byte, 8)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		var re, im float32
+		if endianess {
+			re = math.Float32frombits(binary.BigEndian.Uint32(b[0:4]))
+			im = math.Float32frombits(binary.BigEndian.Uint32(b[4:8]))
+		} else {
+			re = math.Float32frombits(binary.LittleEndian.Uint32(b[0:4]))
+			im = math.Float32frombits(binary.LittleEndian.Uint32(b[4:8]))
+		}
+		v.SetComplex(complex(float64(re), float64(im)))
+		return n, nil
+	case reflect.Complex128: // two IEEE-754 64 bit halves, real then imaginary
+		b := make([]byte, 16)
+		n, err := readFull(in, b)
+		if err != nil {
+			return n, err
+		}
+		var re, im float64
+		if endianess {
+			re = math.Float64frombits(binary.BigEndian.Uint64(b[0:8]))
+			im = math.Float64frombits(binary.BigEndian.Uint64(b[8:16]))
+		} else {
+			re = math.Float64frombits(binary.LittleEndian.Uint64(b[0:8]))
+			im = math.Float64frombits(binary.LittleEndian.Uint64(b[8:16]))
+		}
+		v.SetComplex(complex(re, im))
+		return n, nil
+	case reflect.Array: // fixed length, size known from the type, no length prefix
+		var rc int
+		for i := 0; i < v.Len(); i++ {
+			n, err := unmarshalValue(c, in, v.Index(i), endianess, args)
 			rc += n
-			var length uint64
-			if field.endianess {
-				length = binary.BigEndian.Uint64(b)
-			} else {
-				length = binary.LittleEndian.Uint64(b)
-			}
-			b = make([]byte, length)
-			n, err = in.Read(b)
 			if err != nil {
-				return err
+				return rc, err
 			}
-			rc += n
-			field.v.SetBytes(b)
-		case reflect.TypeFor[string](), reflect.TypeFor[[]byte]():
-			panic("cannot binary encode: types string and []byte are unsuppored for unmarshal")
-		default:
-			panic("cannot binary encode: unsupported type")
 		}
+		return rc, nil
+	case reflect.Struct: // nested struct, recurses to arbitrary depth
+		return c.unmarshalPlan(in, v, EncoderArgs{DefaultEndianess: endianess, MaxStringLength: args.MaxStringLength})
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedType, v.Kind())
 	}
-	return nil
+}
+
+// readSliceLen reads the length-prefix for a slice field using the width
+// named by its len= tag, returning the element count.
+//
+// Like a string's wire length, a slice's element count comes straight off
+// the wire, so it is checked against args.MaxStringLength (reused here as
+// the one cap EncoderArgs offers) before reflect.MakeSlice ever sees it: a
+// u64 prefix greater than math.MaxInt64 would otherwise wrap negative on
+// the int conversion and slip past a naive comparison, and even a merely
+// huge positive count would let an attacker force an unbounded allocation.
+func readSliceLen(in io.Reader, lenTag string, endianess bool, args EncoderArgs) (int, int, error) {
+	switch lenTag {
+	case "u8":
+		b := make([]byte, 1)
+		n, err := readFull(in, b)
+		if err != nil {
+			return 0, n, err
+		}
+		l := int(b[0])
+		return l, n, checkMaxStringLength(l, args)
+	case "u16":
+		b := make([]byte, 2)
+		n, err := readFull(in, b)
+		if err != nil {
+			return 0, n, err
+		}
+		var l int
+		if endianess {
+			l = int(binary.BigEndian.Uint16(b))
+		} else {
+			l = int(binary.LittleEndian.Uint16(b))
+		}
+		return l, n, checkMaxStringLength(l, args)
+	case "u32":
+		b := make([]byte, 4)
+		n, err := readFull(in, b)
+		if err != nil {
+			return 0, n, err
+		}
+		var l int
+		if endianess {
+			l = int(binary.BigEndian.Uint32(b))
+		} else {
+			l = int(binary.LittleEndian.Uint32(b))
+		}
+		return l, n, checkMaxStringLength(l, args)
+	case "u64":
+		b := make([]byte, 8)
+		n, err := readFull(in, b)
+		if err != nil {
+			return 0, n, err
+		}
+		var raw uint64
+		if endianess {
+			raw = binary.BigEndian.Uint64(b)
+		} else {
+			raw = binary.LittleEndian.Uint64(b)
+		}
+		// checked in uint64, before the int conversion, for the same
+		// reason checkMaxUint64Length exists for LengthString64.
+		if err := checkMaxUint64Length(raw, args); err != nil {
+			return 0, n, err
+		}
+		return int(raw), n, nil
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported len= width %q", ErrBadTag, lenTag)
+	}
+}
+
+// Unmarshal decodes in's tagged fields in order into out, using the
+// package-level default Codec. Repeated calls for the same struct type
+// reuse its cached field plan.
+func Unmarshal(in io.Reader, out interface{}, args EncoderArgs) error {
+	return defaultCodec.Unmarshal(in, out, args)
+}
+
+// Decode is like Unmarshal, but reads out of buf instead of an io.Reader,
+// returning the number of bytes consumed. It returns io.ErrUnexpectedEOF
+// if buf is shorter than out's encoded form.
+func Decode(buf []byte, out interface{}, args EncoderArgs) (int, error) {
+	r := bytes.NewReader(buf)
+	err := defaultCodec.Unmarshal(r, out, args)
+	n := len(buf) - r.Len()
+	if errors.Is(err, ErrTruncated) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
 }
@@ -3,6 +3,9 @@ package binaryencode
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
+	"math"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -10,12 +13,39 @@ import (
 	"github.com/davecgh/go-spew/spew"
 )
 
+// appendTestVarint mirrors appendVarint's CBOR-style scheme so TestMarshal
+// can build the expected wire bytes independently of the package under test.
+func appendTestVarint(b []byte, u uint64) []byte {
+	switch {
+	case u < 24:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 24, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 25), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 26), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 27), u)
+	}
+}
+
 func genBytes(l int) []byte {
 	b := make([]byte, l)
 	rand.Read(b) // dumb that this is deprecated :/
 	return b
 }
 
+type innerStruct struct {
+	A uint16 `binary:"0"`
+	B uint32 `binary:"1,little"`
+}
+
+func (s *innerStruct) gen() {
+	s.A = uint16(rand.Uint32())
+	s.B = rand.Uint32()
+}
+
 type testStruct struct {
 	Int8  int8  `binary:"0"`
 	Uint8 uint8 `binary:"1"`
@@ -47,6 +77,26 @@ type testStruct struct {
 	LengthString64B LengthString64 `binary:"22,big"`
 	LengthString64L LengthString64 `binary:"23,little"`
 
+	Bool bool `binary:"24"`
+
+	Float32B float32 `binary:"25,big"`
+	Float32L float32 `binary:"26,little"`
+	Float64B float64 `binary:"27,big"`
+	Float64L float64 `binary:"28,little"`
+
+	Complex64B  complex64  `binary:"29,big"`
+	Complex64L  complex64  `binary:"30,little"`
+	Complex128B complex128 `binary:"31,big"`
+	Complex128L complex128 `binary:"32,little"`
+
+	Uint32Array [4]uint32 `binary:"33,big"`
+	Uint16Slice []uint16  `binary:"34,len=u16,big"`
+
+	Nested innerStruct `binary:"35,big"`
+
+	VarintI64 int64  `binary:"36,varint"`
+	VarintU64 uint64 `binary:"37,uvarint"`
+
 	Unindexed uint
 }
 
@@ -80,6 +130,31 @@ func (s *testStruct) gen(sl int) {
 	s.LengthString32L = LengthString32(genBytes(sl))
 	s.LengthString64B = LengthString64(genBytes(sl))
 	s.LengthString64L = LengthString64(genBytes(sl))
+
+	s.Bool = rand.Int31()%2 == 0
+
+	s.Float32B = rand.Float32()
+	s.Float32L = rand.Float32()
+	s.Float64B = rand.Float64()
+	s.Float64L = rand.Float64()
+
+	s.Complex64B = complex(rand.Float32(), rand.Float32())
+	s.Complex64L = complex(rand.Float32(), rand.Float32())
+	s.Complex128B = complex(rand.Float64(), rand.Float64())
+	s.Complex128L = complex(rand.Float64(), rand.Float64())
+
+	for i := range s.Uint32Array {
+		s.Uint32Array[i] = rand.Uint32()
+	}
+	s.Uint16Slice = make([]uint16, sl)
+	for i := range s.Uint16Slice {
+		s.Uint16Slice[i] = uint16(rand.Uint32())
+	}
+
+	s.Nested.gen()
+
+	s.VarintI64 = rand.Int63() - 1<<62
+	s.VarintU64 = rand.Uint64()
 }
 
 func TestMarshal(t *testing.T) {
@@ -122,7 +197,44 @@ func TestMarshal(t *testing.T) {
 	expected = binary.LittleEndian.AppendUint64(expected, uint64(len(marshalable.LengthString64L)))
 	expected = append(expected, marshalable.LengthString64L...)
 
-	outcome := Marshal(marshalable, EncoderArgs{})
+	if marshalable.Bool {
+		expected = append(expected, 1)
+	} else {
+		expected = append(expected, 0)
+	}
+
+	expected = binary.BigEndian.AppendUint32(expected, math.Float32bits(marshalable.Float32B))
+	expected = binary.LittleEndian.AppendUint32(expected, math.Float32bits(marshalable.Float32L))
+	expected = binary.BigEndian.AppendUint64(expected, math.Float64bits(marshalable.Float64B))
+	expected = binary.LittleEndian.AppendUint64(expected, math.Float64bits(marshalable.Float64L))
+
+	expected = binary.BigEndian.AppendUint32(expected, math.Float32bits(real(marshalable.Complex64B)))
+	expected = binary.BigEndian.AppendUint32(expected, math.Float32bits(imag(marshalable.Complex64B)))
+	expected = binary.LittleEndian.AppendUint32(expected, math.Float32bits(real(marshalable.Complex64L)))
+	expected = binary.LittleEndian.AppendUint32(expected, math.Float32bits(imag(marshalable.Complex64L)))
+	expected = binary.BigEndian.AppendUint64(expected, math.Float64bits(real(marshalable.Complex128B)))
+	expected = binary.BigEndian.AppendUint64(expected, math.Float64bits(imag(marshalable.Complex128B)))
+	expected = binary.LittleEndian.AppendUint64(expected, math.Float64bits(real(marshalable.Complex128L)))
+	expected = binary.LittleEndian.AppendUint64(expected, math.Float64bits(imag(marshalable.Complex128L)))
+
+	for _, v := range marshalable.Uint32Array {
+		expected = binary.BigEndian.AppendUint32(expected, v)
+	}
+	expected = binary.BigEndian.AppendUint16(expected, uint16(len(marshalable.Uint16Slice)))
+	for _, v := range marshalable.Uint16Slice {
+		expected = binary.BigEndian.AppendUint16(expected, v)
+	}
+
+	expected = binary.BigEndian.AppendUint16(expected, marshalable.Nested.A)
+	expected = binary.LittleEndian.AppendUint32(expected, marshalable.Nested.B)
+
+	expected = appendTestVarint(expected, uint64((marshalable.VarintI64<<1)^(marshalable.VarintI64>>63)))
+	expected = appendTestVarint(expected, marshalable.VarintU64)
+
+	outcome, err := Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !reflect.DeepEqual(outcome, expected) {
 		t.Log(spew.Sdump(outcome, expected))
@@ -131,18 +243,270 @@ func TestMarshal(t *testing.T) {
 	}
 }
 
-func TestUnmarshal(t *testing.T) { // need to rewrite this so it doesnt always fail
-	TestMarshal(t) // Marshal has to work for this test
+func TestCodec(t *testing.T) {
+	var marshalable testStruct
+	marshalable.gen(12)
+
+	c := NewCodec()
+	if err := c.RegisterType(&marshalable); err != nil {
+		t.Fatal(err)
+	}
 
+	direct, err := Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viaCodec, err := c.Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(direct, viaCodec) {
+		t.Log(spew.Sdump(direct, viaCodec))
+		t.Fail()
+		return
+	}
+
+	var outcome testStruct
+	if err := c.Unmarshal(bytes.NewReader(viaCodec), &outcome, EncoderArgs{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Padding never round-trips: Unmarshal has nothing to set it to, so
+	// its zero value (nil) never matches whatever gen() put there.
+	marshalable.Padding = nil
+	if !reflect.DeepEqual(outcome, marshalable) {
+		t.Log(spew.Sdump(outcome, marshalable))
+		t.Fail()
+		return
+	}
+}
+
+func TestRegisterTypeNil(t *testing.T) {
+	c := NewCodec()
+	if err := c.RegisterType(nil); err == nil {
+		t.Fatal("expected an error registering nil, got nil")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	var marshalable testStruct
+	marshalable.gen(12)
+
+	expected, err := Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := []byte("prefix")
+	outcome, err := Append(append([]byte{}, prefix...), marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(outcome, append(prefix, expected...)) {
+		t.Log(spew.Sdump(outcome, expected))
+		t.Fail()
+		return
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var marshalable testStruct
+	marshalable.gen(12)
+
+	expected, err := Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(expected))
+	n, err := Encode(buf, marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expected) || !reflect.DeepEqual(buf[:n], expected) {
+		t.Log(spew.Sdump(buf[:n], expected))
+		t.Fail()
+		return
+	}
+
+	short := bytes.Repeat([]byte{0xFF}, len(expected)-1)
+	wantUnchanged := append([]byte(nil), short...)
+	if _, err := Encode(short, marshalable, EncoderArgs{}); err != io.ErrShortBuffer {
+		t.Fatalf("expected io.ErrShortBuffer, got %v", err)
+	}
+	if !reflect.DeepEqual(short, wantUnchanged) {
+		t.Fatalf("Encode modified buf on io.ErrShortBuffer: got %v, want %v", short, wantUnchanged)
+	}
+}
+
+func TestDecode(t *testing.T) {
 	var expected testStruct
 	expected.gen(12)
-	unmarshalable := Marshal(expected, EncoderArgs{})
+	encoded, err := Marshal(expected, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outcome testStruct
+	n, err := Decode(encoded, &outcome, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Padding never round-trips: Unmarshal has nothing to set it to, so
+	// its zero value (nil) never matches whatever gen() put there.
+	expected.Padding = nil
+	if n != len(encoded) || !reflect.DeepEqual(outcome, expected) {
+		t.Log(spew.Sdump(outcome, expected))
+		t.Fail()
+		return
+	}
+
+	if _, err := Decode(encoded[:len(encoded)-4], &outcome, EncoderArgs{}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestSize(t *testing.T) {
+	var marshalable testStruct
+	marshalable.gen(12)
+
+	expected, err := Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := Size(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(expected) {
+		t.Fatalf("Size() = %d, want %d", size, len(expected))
+	}
+}
+
+func TestVarint(t *testing.T) {
+	type varintStruct struct {
+		I int64  `binary:"0,varint"`
+		U uint64 `binary:"1,uvarint"`
+	}
+
+	cases := []struct {
+		u       uint64
+		wireLen int
+	}{
+		{0, 1},
+		{23, 1},
+		{24, 2},
+		{math.MaxUint8, 2},
+		{math.MaxUint8 + 1, 3},
+		{math.MaxUint16, 3},
+		{math.MaxUint16 + 1, 5},
+		{math.MaxUint32, 5},
+		{math.MaxUint32 + 1, 9},
+	}
+
+	for _, c := range cases {
+		v := varintStruct{I: -int64(c.u / 2), U: c.u}
+
+		encoded, err := Marshal(v, EncoderArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := Size(v, EncoderArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != len(encoded) {
+			t.Fatalf("u=%d: Size() = %d, want %d", c.u, size, len(encoded))
+		}
+
+		wantLen := sizeVarint(zigZagEncode(v.I)) + c.wireLen
+		if len(encoded) != wantLen {
+			t.Fatalf("u=%d: encoded length = %d, want %d", c.u, len(encoded), wantLen)
+		}
+
+		var outcome varintStruct
+		if err := Unmarshal(bytes.NewReader(encoded), &outcome, EncoderArgs{}); err != nil {
+			t.Fatal(err)
+		}
+		if outcome != v {
+			t.Fatalf("u=%d: roundtrip = %+v, want %+v", c.u, outcome, v)
+		}
+	}
+}
+
+func TestLengthString64Overflow(t *testing.T) {
+	// A LengthString64's 8 byte length prefix is attacker controlled; a
+	// value past math.MaxInt64 must not wrap negative past the
+	// MaxStringLength check and reach make([]byte, length).
+	type lengthStruct struct {
+		L LengthString64 `binary:"0,big"`
+	}
+	huge := bytes.Repeat([]byte{0xFF}, 8)
+	var out lengthStruct
+	if err := Unmarshal(bytes.NewReader(huge), &out, EncoderArgs{MaxStringLength: 100}); !errors.Is(err, ErrStringOverflow) {
+		t.Fatalf("expected ErrStringOverflow, got %v", err)
+	}
+}
+
+func TestSliceLenU64Overflow(t *testing.T) {
+	// A len=u64 slice's element count is attacker controlled and has no
+	// dedicated cap of its own; it must be checked against
+	// MaxStringLength before reflect.MakeSlice ever sees it.
+	type sliceStruct struct {
+		S []uint32 `binary:"0,len=u64,big"`
+	}
+	huge := bytes.Repeat([]byte{0xFF}, 8)
+	var out sliceStruct
+	if err := Unmarshal(bytes.NewReader(huge), &out, EncoderArgs{MaxStringLength: 100}); !errors.Is(err, ErrStringOverflow) {
+		t.Fatalf("expected ErrStringOverflow, got %v", err)
+	}
+}
+
+func TestMaxStringLength(t *testing.T) {
+	var marshalable testStruct
+	marshalable.gen(12)
+
+	args := EncoderArgs{MaxStringLength: len(marshalable.NullString) - 1}
+
+	if _, err := Marshal(marshalable, args); !errors.Is(err, ErrStringOverflow) {
+		t.Fatalf("expected ErrStringOverflow, got %v", err)
+	}
+	if _, err := Size(marshalable, args); !errors.Is(err, ErrStringOverflow) {
+		t.Fatalf("expected ErrStringOverflow, got %v", err)
+	}
+
+	encoded, err := Marshal(marshalable, EncoderArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	var outcome testStruct
-	err := Unmarshal(bytes.NewReader(unmarshalable), &outcome, EncoderArgs{})
+	lenArgs := EncoderArgs{MaxStringLength: len(marshalable.LengthString64B) - 1}
+	if err := Unmarshal(bytes.NewReader(encoded), &outcome, lenArgs); !errors.Is(err, ErrStringOverflow) {
+		t.Fatalf("expected ErrStringOverflow, got %v", err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	TestMarshal(t) // Marshal has to work for this test
+
+	var expected testStruct
+	expected.gen(12)
+	unmarshalable, err := Marshal(expected, EncoderArgs{})
 	if err != nil {
 		t.Fatal(err)
 	}
+	var outcome testStruct
+	if err := Unmarshal(bytes.NewReader(unmarshalable), &outcome, EncoderArgs{}); err != nil {
+		t.Fatal(err)
+	}
 
+	// Padding never round-trips: Unmarshal has nothing to set it to, so
+	// its zero value (nil) never matches whatever gen() put there.
+	expected.Padding = nil
 	if !reflect.DeepEqual(outcome, expected) {
 		t.Log(spew.Sdump(outcome, expected))
 		t.Fail()